@@ -1,15 +1,29 @@
 package lightgbm
 
 import (
+    "bufio"
+    "encoding/json"
     "fmt"
+    "io"
+    "math"
     "os"
+    "path/filepath"
+    "sort"
     "strconv"
     "strings"
     "sync"
 
     "github.com/metacubex/mihomo/log"
+
+    "gopkg.in/yaml.v3"
 )
 
+// LoadTransformsFromModel prefers a sidecar <modelPath>.transforms.json or
+// .yaml/.yml file over the embedded block below, falling back to the
+// embedded block only when no sidecar file is present. See
+// LoadTransformsFromFile for the sidecar format (the same FeatureTransforms
+// struct, JSON- or YAML-encoded).
+//
 // parseTransformsContent parses the [transforms] section from the model file.
 // The expected format is as follows:
 //
@@ -30,9 +44,30 @@ import (
 // robust_features=0,1
 // robust_center=...comma separated float values...
 // robust_scale=...comma separated float values...
+//
+// qt_type=QuantileTransformer
+// qt_features=2,3
+// qt_quantiles_0=...comma separated float values, length K...
+// qt_quantiles_1=...comma separated float values, length K...
+// qt_references=...comma separated float values, length K, shared target CDF...
+// qt_output=normal|uniform (optional, defaults to uniform)
+//
+// pt_type=PowerTransformer
+// pt_features=4,5
+// pt_lambdas=...comma separated float values, one per feature (Yeo-Johnson)...
+// pt_mean=...comma separated float values...
+// pt_scale=...comma separated float values...
+//
+// cat_type=CategoricalEncoder
+// cat_features=17,18,19,20
+// cat_mode=onehot|target|frequency
+// cat_vocab_0=12345:0,67890:1,default:2   (onehot: value->code)
+// cat_stat_0=12345:0.42,67890:0.11,default:0.2   (target/frequency: value->stat)
 // [/definitions]
 //
 // untransformed_features=8:is_udp,9:is_tcp,10:asn_feature,...
+// pipeline=std,robust,qt,pt,cat
+// allow_chain=true
 // transform=true
 // [/transforms]
 //
@@ -43,25 +78,67 @@ import (
 // - All indices and parameter arrays must match the feature order and count.
 // - Only features listed in *_features are transformed; others remain unchanged.
 // - The Go parser expects strict adherence to this structure for correct parsing.
+// - A CategoricalEncoder in onehot mode is the one exception to "others
+//   remain unchanged": it replaces its feature's single column with one
+//   column per vocabulary entry, so ApplyTransforms' output can be wider
+//   than its input. Use OutputFeatureCount to size buffers accordingly.
+// - QuantileTransformer and CategoricalEncoder parameters do not follow the
+//   "length must match features" rule: qt_quantiles_<i> and qt_references
+//   hold K values each, *_output and *_mode are plain strings, and
+//   cat_vocab_<i>/cat_stat_<i> hold value:number pairs.
+// - pipeline= fixes the application order of [definitions] blocks and is
+//   required for deterministic results when blocks touch overlapping
+//   features; every ID it lists must be defined, and every defined ID
+//   should be listed or it is dropped. Stages may not touch the same
+//   feature index unless allow_chain=true, in which case later stages see
+//   the output of earlier ones.
 
 type TransformType string
 
 const (
-    StandardScalerTransform TransformType = "StandardScaler"
-    RobustScalerTransform   TransformType = "RobustScaler"
+    StandardScalerTransform      TransformType = "StandardScaler"
+    RobustScalerTransform        TransformType = "RobustScaler"
+    QuantileTransformerTransform TransformType = "QuantileTransformer"
+    PowerTransformerTransform    TransformType = "PowerTransformer"
+    CategoricalEncoderTransform  TransformType = "CategoricalEncoder"
 )
 
 type TransformParams struct {
-    Type           TransformType            `json:"type"`
-    FeatureIndices []int                   `json:"feature_indices"`
-    Parameters     map[string][]float64    `json:"parameters"`
+    // ID is the transform's prefix in [definitions] (e.g. "std", "qt"). It
+    // is what a pipeline= directive refers to, and is preserved here so
+    // stages keep their identity after parsing reorders them.
+    ID             string                   `json:"id" yaml:"id"`
+    Type           TransformType            `json:"type" yaml:"type"`
+    FeatureIndices []int                   `json:"feature_indices" yaml:"feature_indices"`
+    Parameters     map[string][]float64    `json:"parameters" yaml:"parameters"`
+    // Options holds non-numeric, string-valued parameters (e.g. qt_output=normal, cat_mode=onehot).
+    Options        map[string]string       `json:"options,omitempty" yaml:"options,omitempty"`
+    // Vocab holds, for a CategoricalEncoder, the value->code map per local
+    // feature index (index into FeatureIndices). Used by "onehot" mode.
+    Vocab          map[int]map[string]float64 `json:"vocab,omitempty" yaml:"vocab,omitempty"`
+    // Stats holds, for a CategoricalEncoder, the value->stat map per local
+    // feature index. Used by "target" and "frequency" modes. The key
+    // "default" provides the fallback stat for unseen categories.
+    Stats          map[int]map[string]float64 `json:"stats,omitempty" yaml:"stats,omitempty"`
 }
 
 type FeatureTransforms struct {
-    TransformsEnabled      bool                        `json:"transforms_enabled"`
-    FeatureOrder           map[int]string              `json:"order"`
-    Transforms             []TransformParams           `json:"transforms"`
-    UntransformedFeatures  []string                    `json:"untransformed_features"`
+    TransformsEnabled      bool                        `json:"transforms_enabled" yaml:"transforms_enabled"`
+    FeatureOrder           map[int]string              `json:"order" yaml:"order"`
+    Transforms             []TransformParams           `json:"transforms" yaml:"transforms"`
+    UntransformedFeatures  []string                    `json:"untransformed_features" yaml:"untransformed_features"`
+    // Pipeline is the declared `pipeline=id,id,...` ordering of transform
+    // IDs. When set, parseTransformsContent uses it as the sole source of
+    // truth for the order of Transforms and for which defined transforms are
+    // kept. ApplyTransforms applies Transforms in slice order and does not
+    // read Pipeline, so LoadTransformsFromFile does not reorder or filter by it.
+    Pipeline               []string                    `json:"pipeline,omitempty" yaml:"pipeline,omitempty"`
+    // AllowChain mirrors `allow_chain=true`: when set, parseTransformsContent
+    // lets later pipeline stages touch features an earlier stage already
+    // transformed, and they see that stage's output rather than the raw
+    // input value. Transforms loaded by LoadTransformsFromFile are not
+    // checked for overlap.
+    AllowChain             bool                        `json:"allow_chain,omitempty" yaml:"allow_chain,omitempty"`
 }
 
 var transformPool = sync.Pool{
@@ -72,57 +149,152 @@ var transformPool = sync.Pool{
 
 // 读取transforms参数
 func LoadTransformsFromModel(modelPath string) (*FeatureTransforms, error) {
+    if featureTransforms, ok, err := loadSidecarTransforms(modelPath); err != nil {
+        return nil, err
+    } else if ok {
+        return featureTransforms, nil
+    }
+
     file, err := os.Open(modelPath)
     if err != nil {
         return nil, fmt.Errorf("failed to open model file: %v", err)
     }
     defer file.Close()
 
-    stat, err := file.Stat()
+    transformsContent, found, err := scanForTransformsBlock(file)
     if err != nil {
-        return nil, fmt.Errorf("failed to get file info: %v", err)
+        return nil, fmt.Errorf("failed to read file content: %v", err)
     }
-
-    readSize := int64(16384)
-    if stat.Size() < readSize {
-        readSize = stat.Size()
+    if !found {
+        return &FeatureTransforms{
+            TransformsEnabled: false,
+            FeatureOrder:      getDefaultFeatureOrder(),
+            Transforms:        []TransformParams{},
+        }, nil
     }
 
-    _, err = file.Seek(-readSize, 2)
+    featureTransforms, err := parseTransformsContent(transformsContent)
     if err != nil {
-        return nil, fmt.Errorf("failed to seek file position: %v", err)
+        return nil, fmt.Errorf("failed to parse transforms parameters: %v", err)
     }
 
-    buffer := make([]byte, readSize)
-    _, err = file.Read(buffer)
-    if err != nil {
-        return nil, fmt.Errorf("failed to read file content: %v", err)
-    }
+    return featureTransforms, nil
+}
 
-    content := string(buffer)
+// scanForTransformsBlock locates a "[transforms]"..."[/transforms]" block in
+// r without reading the whole model file into memory: a text LightGBM model
+// can be several megabytes, but the block it actually needs is typically a
+// few KB at the tail. It reads in scanChunkSize chunks, keeping only enough
+// trailing bytes to catch a marker split across a read boundary, and starts
+// buffering only once the start marker itself has been found. Returns
+// found=false, with no error, if the start marker never appears, and an
+// error if the start marker appears with no end marker after it.
+const scanChunkSize = 64 * 1024
+
+func scanForTransformsBlock(r io.Reader) (string, bool, error) {
+    const (
+        startMarker = "[transforms]"
+        endMarker   = "[/transforms]"
+    )
+
+    reader := bufio.NewReaderSize(r, scanChunkSize)
+    buf := make([]byte, scanChunkSize)
+
+    // search holds bytes not yet found to contain the start marker, capped
+    // at len(startMarker)-1 so it never buffers more than a sliver of the
+    // file while scanning for it.
+    search := ""
+    // block accumulates the bytes seen after the start marker, since there's
+    // no way to know how far ahead the end marker is without reading them.
+    var block strings.Builder
+    afterStart := false
+
+    for {
+        n, readErr := reader.Read(buf)
+        if n > 0 {
+            if !afterStart {
+                search += string(buf[:n])
+                if idx := strings.Index(search, startMarker); idx != -1 {
+                    afterStart = true
+                    block.WriteString(search[idx+len(startMarker):])
+                    search = ""
+                } else if overlap := len(startMarker) - 1; len(search) > overlap {
+                    search = search[len(search)-overlap:]
+                }
+            } else {
+                block.WriteString(string(buf[:n]))
+            }
 
-    startMarker := "[transforms]"
-    endMarker := "[/transforms]"
+            if afterStart {
+                if idx := strings.Index(block.String(), endMarker); idx != -1 {
+                    return block.String()[:idx], true, nil
+                }
+            }
+        }
+        if readErr == io.EOF {
+            break
+        }
+        if readErr != nil {
+            return "", false, readErr
+        }
+    }
 
-    startIdx := strings.Index(content, startMarker)
-    if startIdx == -1 {
-        return &FeatureTransforms{
-            TransformsEnabled: false,
-            FeatureOrder:      getDefaultFeatureOrder(),
-            Transforms:        []TransformParams{},
-        }, nil
+    if afterStart {
+        return "", false, fmt.Errorf("found transforms start marker but no end marker")
     }
+    return "", false, nil
+}
+
+// loadSidecarTransforms looks for <modelPath>.transforms.json or
+// <modelPath>.transforms.yaml/.yml next to the model file. If one exists it
+// is loaded in preference to the embedded [transforms] block, since it has
+// no size limit and is easier to generate from a scikit-learn pipeline than
+// hand-editing the tail of a LightGBM text model.
+func loadSidecarTransforms(modelPath string) (*FeatureTransforms, bool, error) {
+    for _, ext := range []string{".json", ".yaml", ".yml"} {
+        sidecarPath := modelPath + ".transforms" + ext
+        if _, err := os.Stat(sidecarPath); err != nil {
+            continue
+        }
 
-    endIdx := strings.Index(content, endMarker)
-    if endIdx == -1 {
-        return nil, fmt.Errorf("found transforms start marker but no end marker")
+        featureTransforms, err := LoadTransformsFromFile(sidecarPath)
+        if err != nil {
+            return nil, true, fmt.Errorf("failed to load sidecar transforms file %s: %v", sidecarPath, err)
+        }
+        return featureTransforms, true, nil
     }
 
-    transformsContent := content[startIdx+len(startMarker):endIdx]
+    return nil, false, nil
+}
 
-    featureTransforms, err := parseTransformsContent(transformsContent)
+// LoadTransformsFromFile loads a FeatureTransforms from a standalone JSON or
+// YAML file (selected by extension), as exported by a scikit-learn
+// sklearn.pipeline.Pipeline via a small Python helper. This is the preferred
+// way to configure transforms once they grow too large to comfortably embed
+// in the LightGBM model's [transforms] tail.
+func LoadTransformsFromFile(path string) (*FeatureTransforms, error) {
+    data, err := os.ReadFile(path)
     if err != nil {
-        return nil, fmt.Errorf("failed to parse transforms parameters: %v", err)
+        return nil, fmt.Errorf("failed to read transforms file: %v", err)
+    }
+
+    featureTransforms := &FeatureTransforms{}
+
+    switch ext := strings.ToLower(filepath.Ext(path)); ext {
+    case ".json":
+        if err := json.Unmarshal(data, featureTransforms); err != nil {
+            return nil, fmt.Errorf("failed to parse transforms JSON: %v", err)
+        }
+    case ".yaml", ".yml":
+        if err := yaml.Unmarshal(data, featureTransforms); err != nil {
+            return nil, fmt.Errorf("failed to parse transforms YAML: %v", err)
+        }
+    default:
+        return nil, fmt.Errorf("unsupported transforms file extension: %s", ext)
+    }
+
+    if len(featureTransforms.FeatureOrder) == 0 {
+        featureTransforms.FeatureOrder = getDefaultFeatureOrder()
     }
 
     return featureTransforms, nil
@@ -204,17 +376,22 @@ func parseTransformsContent(content string) (*FeatureTransforms, error) {
                 featureTransforms.TransformsEnabled = value == "true"
             case "untransformed_features":
                 featureTransforms.UntransformedFeatures = parseStringArray(value)
+            case "pipeline":
+                featureTransforms.Pipeline = parseStringArray(value)
+            case "allow_chain":
+                featureTransforms.AllowChain = value == "true"
             }
         }
     }
 
-    validTransformCount := 0
+    validTransforms := make(map[string]*TransformParams)
     for transformID, params := range transformDefs {
         transform, err := buildTransformParams(params)
         if err != nil {
             errors = append(errors, fmt.Sprintf("failed to build transform %s: %v", transformID, err))
             continue
         }
+        transform.ID = transformID
 
         if len(transform.FeatureIndices) == 0 {
             errors = append(errors, fmt.Sprintf("transform %s has no feature indices", transformID))
@@ -234,6 +411,65 @@ func parseTransformsContent(content string) (*FeatureTransforms, error) {
             continue
         }
 
+        validTransforms[transformID] = transform
+    }
+
+    // Determine application order. A declared pipeline= is the sole source
+    // of truth for both order and membership; without one we fall back to
+    // a stable order (sorted by ID) instead of map iteration order, which
+    // Go does not guarantee is stable across runs.
+    var orderedIDs []string
+    if len(featureTransforms.Pipeline) > 0 {
+        seen := make(map[string]bool)
+        for _, id := range featureTransforms.Pipeline {
+            if seen[id] {
+                errors = append(errors, fmt.Sprintf("pipeline lists transform %q more than once", id))
+                continue
+            }
+            if _, exists := validTransforms[id]; !exists {
+                errors = append(errors, fmt.Sprintf("pipeline references undefined transform %q", id))
+                continue
+            }
+            seen[id] = true
+            orderedIDs = append(orderedIDs, id)
+        }
+        for id := range validTransforms {
+            if !seen[id] {
+                errors = append(errors, fmt.Sprintf("transform %q defined but not referenced by pipeline, skipping", id))
+            }
+        }
+    } else {
+        // No pipeline= declared: fall back to sorting by ID rather than
+        // ranging over validTransforms, since Go does not guarantee map
+        // iteration order is stable across runs. Harmless when stages don't
+        // share features (they commute), but observable with
+        // allow_chain=true, where which stage "wins" a shared feature
+        // depends on order.
+        for id := range validTransforms {
+            orderedIDs = append(orderedIDs, id)
+        }
+        sort.Strings(orderedIDs)
+    }
+
+    validTransformCount := 0
+    touchedBy := make(map[int]string)
+    for _, id := range orderedIDs {
+        transform := validTransforms[id]
+
+        overlaps := false
+        for _, idx := range transform.FeatureIndices {
+            if owner, exists := touchedBy[idx]; exists && !featureTransforms.AllowChain {
+                errors = append(errors, fmt.Sprintf("transform %q overlaps feature %d already used by %q (set allow_chain=true to permit)", id, idx, owner))
+                overlaps = true
+            }
+        }
+        if overlaps {
+            continue
+        }
+        for _, idx := range transform.FeatureIndices {
+            touchedBy[idx] = id
+        }
+
         featureTransforms.Transforms = append(featureTransforms.Transforms, *transform)
         validTransformCount++
     }
@@ -262,6 +498,7 @@ func parseTransformsContent(content string) (*FeatureTransforms, error) {
 func buildTransformParams(params map[string]string) (*TransformParams, error) {
     transform := &TransformParams{
         Parameters: make(map[string][]float64),
+        Options:    make(map[string]string),
     }
 
     if typeStr, exists := params["type"]; exists {
@@ -281,18 +518,111 @@ func buildTransformParams(params map[string]string) (*TransformParams, error) {
     }
 
     for paramName, paramValue := range params {
-        if paramName != "type" && paramName != "features" {
-            values, err := parseFloatArray(paramValue)
+        if paramName == "type" || paramName == "features" {
+            continue
+        }
+
+        if isStringOptionParam(paramName) {
+            transform.Options[paramName] = paramValue
+            continue
+        }
+
+        if localIdx, ok := categoryParamIndex(paramName, "vocab_"); ok {
+            pairs, err := parseCategoryPairs(paramValue)
             if err != nil {
-                return nil, fmt.Errorf("failed to parse parameter %s: %v", paramName, err)
+                return nil, fmt.Errorf("failed to parse %s: %v", paramName, err)
             }
-            transform.Parameters[paramName] = values
+            if transform.Vocab == nil {
+                transform.Vocab = make(map[int]map[string]float64)
+            }
+            transform.Vocab[localIdx] = pairs
+            continue
+        }
+
+        if localIdx, ok := categoryParamIndex(paramName, "stat_"); ok {
+            pairs, err := parseCategoryPairs(paramValue)
+            if err != nil {
+                return nil, fmt.Errorf("failed to parse %s: %v", paramName, err)
+            }
+            if transform.Stats == nil {
+                transform.Stats = make(map[int]map[string]float64)
+            }
+            transform.Stats[localIdx] = pairs
+            continue
+        }
+
+        values, err := parseFloatArray(paramValue)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse parameter %s: %v", paramName, err)
         }
+        transform.Parameters[paramName] = values
     }
 
     return transform, nil
 }
 
+// isStringOptionParam reports whether a definition param carries a string
+// value (e.g. "normal"/"uniform", "onehot"/"target"/"frequency") instead of
+// a comma-separated float array.
+func isStringOptionParam(paramName string) bool {
+    switch paramName {
+    case "output", "mode":
+        return true
+    default:
+        return false
+    }
+}
+
+// categoryParamIndex reports whether paramName is "<prefix><n>" and, if so,
+// returns n (the local feature index, i.e. the index into FeatureIndices).
+func categoryParamIndex(paramName, prefix string) (int, bool) {
+    if !strings.HasPrefix(paramName, prefix) {
+        return 0, false
+    }
+    idx, err := strconv.Atoi(strings.TrimPrefix(paramName, prefix))
+    if err != nil {
+        return 0, false
+    }
+    return idx, true
+}
+
+// parseCategoryPairs parses "value:stat,value:stat,..." into a map, where
+// value is the raw category key and stat is either a one-hot code or a
+// target/frequency statistic. The key "default" is reserved for the
+// fallback applied to categories not seen during training.
+func parseCategoryPairs(value string) (map[string]float64, error) {
+    result := make(map[string]float64)
+    if value == "" {
+        return result, nil
+    }
+
+    for _, pair := range strings.Split(value, ",") {
+        pair = strings.TrimSpace(pair)
+        if pair == "" {
+            continue
+        }
+
+        kv := strings.SplitN(pair, ":", 2)
+        if len(kv) != 2 {
+            return nil, fmt.Errorf("invalid category pair %q", pair)
+        }
+
+        stat, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid category value in pair %q: %v", pair, err)
+        }
+        result[strings.TrimSpace(kv[0])] = stat
+    }
+
+    return result, nil
+}
+
+// categoryKey renders a raw feature value into the same string form used
+// as a key in cat_vocab_/cat_stat_ pairs.
+func categoryKey(x float64) string {
+    return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
 func parseFloatArray(value string) ([]float64, error) {
     if value == "" {
         return []float64{}, nil
@@ -358,25 +688,56 @@ func getDefaultFeatureOrder() map[int]string {
     }
 }
 
+// ApplyTransforms is a convenience wrapper around ApplyTransformsInto for
+// callers that don't own a reusable buffer: it borrows one via NewBuffer,
+// transforms into it, and copies the result into a freshly allocated slice
+// before releasing the buffer back to the pool. That final copy is a
+// per-call allocation by design, since the returned slice can outlive the
+// call. It is NOT the zero-allocation hot path — a per-connection scoring
+// loop that calls this on every connection should instead keep its own
+// buffer across calls and call ApplyTransformsInto directly, skipping both
+// the pool round-trip and the copy. There is no such caller in this package
+// yet; wiring one up is out of scope here since it lives in the smart
+// selector, which this package does not contain.
 func (ft *FeatureTransforms) ApplyTransforms(features []float64) []float64 {
     if ft == nil || !ft.TransformsEnabled || len(ft.Transforms) == 0 {
         return features
     }
 
-    var result []float64
-    poolObj := transformPool.Get()
-    if arr, ok := poolObj.([]float64); ok && len(arr) >= len(features) {
-        result = arr[:len(features)]
-    } else {
-        result = make([]float64, len(features))
+    needed := ft.OutputFeatureCount(len(features))
+
+    buf := ft.NewBuffer()
+    if len(buf) < needed {
+        buf = make([]float64, needed)
     }
-    copy(result, features)
+    dst := buf[:needed]
 
+    if err := ft.ApplyTransformsInto(dst, features); err != nil {
+        log.Errorln("[Smart] ApplyTransforms: %v", err)
+        ft.ReleaseBuffer(buf)
+        return features
+    }
+
+    out := make([]float64, needed)
+    copy(out, dst)
+
+    // buf must not go back to the pool until the copy above has finished
+    // reading from it, or a concurrent Get() could hand the same backing
+    // array to another goroutine mid-copy.
+    ft.ReleaseBuffer(buf)
+
+    return out
+}
+
+// applyAllInPlace runs every configured transform over features in pipeline
+// order, mutating it directly. It does not handle onehot expansion, which
+// changes the output width; see expandOneHot for that.
+func (ft *FeatureTransforms) applyAllInPlace(features []float64) {
     errors := []string{}
     for i, transform := range ft.Transforms {
         validTransform := true
         for _, idx := range transform.FeatureIndices {
-            if idx < 0 || idx >= len(result) {
+            if idx < 0 || idx >= len(features) {
                 errors = append(errors, fmt.Sprintf("transform %d feature index %d out of range", i, idx))
                 validTransform = false
                 break
@@ -384,27 +745,216 @@ func (ft *FeatureTransforms) ApplyTransforms(features []float64) []float64 {
         }
 
         if validTransform {
-            ft.applyTransformInPlace(result, transform)
+            ft.applyTransformInPlace(features, transform)
         }
     }
 
     if len(errors) > 0 {
         log.Errorln("[Smart] Apply transforms errors: %s", strings.Join(errors, "; "))
     }
+}
+
+// ApplyTransformsInto transforms src into dst without touching the shared
+// pool, for callers (e.g. per-connection scoring) that already own a
+// reusable buffer and want to avoid an allocation on every call. dst must be
+// at least ft.OutputFeatureCount(len(src)) long. src and dst may overlap:
+// with a onehot CategoricalEncoder configured, src is first copied into a
+// scratch slice, so that path allocates on every call.
+func (ft *FeatureTransforms) ApplyTransformsInto(dst, src []float64) error {
+    if ft == nil || !ft.TransformsEnabled || len(ft.Transforms) == 0 {
+        if len(dst) < len(src) {
+            return fmt.Errorf("destination buffer too small: need %d, have %d", len(src), len(dst))
+        }
+        copy(dst, src)
+        return nil
+    }
+
+    needed := ft.OutputFeatureCount(len(src))
+    if len(dst) < needed {
+        return fmt.Errorf("destination buffer too small: need %d, have %d", needed, len(dst))
+    }
+
+    if !ft.hasOneHotEncoder() {
+        copy(dst[:len(src)], src)
+        ft.applyAllInPlace(dst[:len(src)])
+        return nil
+    }
+
+    scratch := make([]float64, len(src))
+    copy(scratch, src)
+    ft.applyAllInPlace(scratch)
 
-    transformPool.Put(result)
+    expanded := ft.expandOneHot(scratch)
+    copy(dst[:len(expanded)], expanded)
+    return nil
+}
+
+// hasOneHotEncoder reports whether any configured transform is a
+// CategoricalEncoder in "onehot" mode, i.e. whether applying transforms can
+// change the feature count.
+func (ft *FeatureTransforms) hasOneHotEncoder() bool {
+    for _, transform := range ft.Transforms {
+        if transform.Type == CategoricalEncoderTransform && transform.Options["mode"] == "onehot" {
+            return true
+        }
+    }
+    return false
+}
+
+// NewBuffer returns a pooled buffer sized for ApplyTransformsInto's
+// non-onehot path. Callers with a onehot CategoricalEncoder configured must
+// size their own buffer via OutputFeatureCount instead.
+func (ft *FeatureTransforms) NewBuffer() []float64 {
+    if arr, ok := transformPool.Get().([]float64); ok {
+        return arr
+    }
+    return make([]float64, MaxFeatureSize)
+}
+
+// ReleaseBuffer returns a buffer obtained from NewBuffer to the pool. The
+// caller must be done reading from buf before calling this.
+func (ft *FeatureTransforms) ReleaseBuffer(buf []float64) {
+    transformPool.Put(buf)
+}
+
+// OutputFeatureCount returns the width of the feature vector ApplyTransforms
+// produces for an input of inputFeatureCount features. It matches
+// inputFeatureCount unless a CategoricalEncoder transform with mode=onehot
+// is configured, in which case each encoded feature expands into one column
+// per vocabulary entry instead of staying a single column. Callers that size
+// a LightGBM input buffer ahead of time (e.g. a pooled scoring buffer) must
+// use this instead of assuming input length == output length, and should
+// use ExpandedFeatureOrder to label the resulting columns.
+func (ft *FeatureTransforms) OutputFeatureCount(inputFeatureCount int) int {
+    if ft == nil || !ft.TransformsEnabled {
+        return inputFeatureCount
+    }
+
+    count := inputFeatureCount
+    for _, transform := range ft.Transforms {
+        if transform.Type != CategoricalEncoderTransform || transform.Options["mode"] != "onehot" {
+            continue
+        }
+        for i := range transform.FeatureIndices {
+            if size := oneHotVocabSize(transform.Vocab[i]); size > 1 {
+                count += size - 1
+            }
+        }
+    }
+    return count
+}
+
+// ExpandedFeatureOrder mirrors OutputFeatureCount for column names: it
+// returns the name of every column ApplyTransforms/ApplyTransformsInto
+// produces for an input of inputFeatureCount features, so a caller building
+// a LightGBM input vector can label the columns a onehot CategoricalEncoder
+// adds. Expanded columns are named "<feature>#<code>"; everything else keeps
+// its FeatureOrder name shifted to its new position.
+func (ft *FeatureTransforms) ExpandedFeatureOrder(inputFeatureCount int) map[int]string {
+    if ft == nil {
+        return nil
+    }
+
+    vocabByFeature := ft.onehotVocabByFeature()
+    if !ft.TransformsEnabled || len(vocabByFeature) == 0 {
+        return ft.FeatureOrder
+    }
+
+    expanded := make(map[int]string, ft.OutputFeatureCount(inputFeatureCount))
+    outIdx := 0
+    for idx := 0; idx < inputFeatureCount; idx++ {
+        vocab, isCategorical := vocabByFeature[idx]
+        if !isCategorical {
+            expanded[outIdx] = ft.FeatureOrder[idx]
+            outIdx++
+            continue
+        }
+
+        for code := 0; code < oneHotVocabSize(vocab); code++ {
+            expanded[outIdx] = fmt.Sprintf("%s#%d", ft.FeatureOrder[idx], code)
+            outIdx++
+        }
+    }
+    return expanded
+}
+
+// onehotVocabByFeature collects, across every onehot CategoricalEncoder, the
+// value->code vocab keyed by the original feature index it replaces.
+func (ft *FeatureTransforms) onehotVocabByFeature() map[int]map[string]float64 {
+    vocabByFeature := make(map[int]map[string]float64)
+    for _, transform := range ft.Transforms {
+        if transform.Type != CategoricalEncoderTransform || transform.Options["mode"] != "onehot" {
+            continue
+        }
+        for i, featureIdx := range transform.FeatureIndices {
+            vocabByFeature[featureIdx] = transform.Vocab[i]
+        }
+    }
+    return vocabByFeature
+}
+
+// expandOneHot replaces each feature column touched by a CategoricalEncoder
+// in "onehot" mode with its one-hot block, leaving every other column's
+// value untouched and in its original relative order (columns after an
+// expanded one move to later positions). If no onehot encoder is configured it returns
+// features unchanged (same backing array).
+func (ft *FeatureTransforms) expandOneHot(features []float64) []float64 {
+    vocabByFeature := ft.onehotVocabByFeature()
+    if len(vocabByFeature) == 0 {
+        return features
+    }
+
+    out := make([]float64, 0, ft.OutputFeatureCount(len(features)))
+    for idx, val := range features {
+        vocab, isCategorical := vocabByFeature[idx]
+        if !isCategorical {
+            out = append(out, val)
+            continue
+        }
+
+        columns := make([]float64, oneHotVocabSize(vocab))
+        if code, ok := vocab[categoryKey(val)]; ok && int(code) < len(columns) {
+            columns[int(code)] = 1
+        } else if fallback, ok := vocab["default"]; ok && int(fallback) < len(columns) {
+            columns[int(fallback)] = 1
+        }
+        out = append(out, columns...)
+    }
 
-    out := make([]float64, len(result))
-    copy(out, result)
     return out
 }
 
+// oneHotVocabSize returns the number of one-hot columns a vocab needs, sized
+// off the highest assigned code so gaps are padded with zero columns rather
+// than silently compacted. "default" is an ordinary code here: if it is
+// given its own code (as in cat_vocab_0=12345:0,67890:1,default:2) it gets a
+// dedicated "unknown category" column; callers that want unseen categories
+// to just produce an all-zero row should omit default entirely.
+func oneHotVocabSize(vocab map[string]float64) int {
+    size := 0
+    for _, code := range vocab {
+        if n := int(code) + 1; n > size {
+            size = n
+        }
+    }
+    if size == 0 {
+        size = 1
+    }
+    return size
+}
+
 func (ft *FeatureTransforms) applyTransformInPlace(features []float64, transform TransformParams) {
     switch transform.Type {
     case StandardScalerTransform:
         ft.applyStandardScaler(features, transform)
     case RobustScalerTransform:
         ft.applyRobustScaler(features, transform)
+    case QuantileTransformerTransform:
+        ft.applyQuantileTransformer(features, transform)
+    case PowerTransformerTransform:
+        ft.applyPowerTransformer(features, transform)
+    case CategoricalEncoderTransform:
+        ft.applyCategoricalEncoder(features, transform)
     default:
         log.Errorln("[Smart] Unknown transform type: %s", transform.Type)
     }
@@ -460,6 +1010,189 @@ func (ft *FeatureTransforms) applyRobustScaler(features []float64, transform Tra
     }
 }
 
+// 分位数变换
+func (ft *FeatureTransforms) applyQuantileTransformer(features []float64, transform TransformParams) {
+    references := transform.Parameters["references"]
+    if len(references) == 0 {
+        return
+    }
+
+    outputDistribution := transform.Options["output"]
+    if outputDistribution == "" {
+        outputDistribution = "uniform"
+    }
+
+    errors := []string{}
+    for i, featureIdx := range transform.FeatureIndices {
+        if featureIdx < 0 || featureIdx >= len(features) {
+            continue
+        }
+
+        quantiles := transform.Parameters[fmt.Sprintf("quantiles_%d", i)]
+        if len(quantiles) != len(references) {
+            errors = append(errors, fmt.Sprintf("quantiles_%d length mismatch with references for feature %d", i, featureIdx))
+            continue
+        }
+
+        t := interpolateQuantile(features[featureIdx], quantiles, references)
+        if outputDistribution == "normal" {
+            t = normInvCDF(t)
+        }
+        features[featureIdx] = t
+    }
+
+    if len(errors) > 0 {
+        log.Errorln("[Smart] QuantileTransformer errors: %s", strings.Join(errors, "; "))
+    }
+}
+
+// interpolateQuantile locates x within the sorted quantiles_ array and
+// linearly interpolates the corresponding value on the references_ CDF,
+// clamping at both ends.
+func interpolateQuantile(x float64, quantiles, references []float64) float64 {
+    n := len(quantiles)
+    if x <= quantiles[0] {
+        return references[0]
+    }
+    if x >= quantiles[n-1] {
+        return references[n-1]
+    }
+
+    lo, hi := 0, n-1
+    for hi-lo > 1 {
+        mid := (lo + hi) / 2
+        if quantiles[mid] <= x {
+            lo = mid
+        } else {
+            hi = mid
+        }
+    }
+
+    span := quantiles[hi] - quantiles[lo]
+    if span == 0 {
+        return references[lo]
+    }
+
+    ratio := (x - quantiles[lo]) / span
+    return references[lo] + ratio*(references[hi]-references[lo])
+}
+
+// normInvCDF approximates the inverse standard normal CDF (probit function)
+// using Acklam's rational approximation.
+func normInvCDF(p float64) float64 {
+    const lowerTail = 0.02425
+    upperTail := 1 - lowerTail
+
+    if p <= 0 {
+        p = 1e-10
+    } else if p >= 1 {
+        p = 1 - 1e-10
+    }
+
+    a := [6]float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02, 1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+    b := [5]float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02, 6.680131188771972e+01, -1.328068155288572e+01}
+    c := [6]float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00, -2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+    d := [4]float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00, 3.754408661907416e+00}
+
+    switch {
+    case p < lowerTail:
+        q := math.Sqrt(-2 * math.Log(p))
+        return (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+            ((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+    case p <= upperTail:
+        q := p - 0.5
+        r := q * q
+        return (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+            (((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+    default:
+        q := math.Sqrt(-2 * math.Log(1-p))
+        return -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+            ((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+    }
+}
+
+// 幂变换（Yeo-Johnson）
+func (ft *FeatureTransforms) applyPowerTransformer(features []float64, transform TransformParams) {
+    lambdas := transform.Parameters["lambdas"]
+    mean := transform.Parameters["mean"]
+    scale := transform.Parameters["scale"]
+
+    if len(lambdas) == 0 {
+        return
+    }
+
+    expectedCount := len(transform.FeatureIndices)
+    if len(lambdas) != expectedCount || len(mean) != expectedCount || len(scale) != expectedCount {
+        log.Errorln("[Smart] PowerTransformer parameter count mismatch, expected %d, got lambdas=%d mean=%d scale=%d",
+            expectedCount, len(lambdas), len(mean), len(scale))
+        return
+    }
+
+    errors := []string{}
+    for i, featureIdx := range transform.FeatureIndices {
+        if featureIdx < 0 || featureIdx >= len(features) {
+            continue
+        }
+        if scale[i] == 0 {
+            errors = append(errors, fmt.Sprintf("scale[%d] is zero for feature %d", i, featureIdx))
+            continue
+        }
+
+        y := yeoJohnson(features[featureIdx], lambdas[i])
+        features[featureIdx] = (y - mean[i]) / scale[i]
+    }
+
+    if len(errors) > 0 {
+        log.Errorln("[Smart] PowerTransformer errors: %s", strings.Join(errors, "; "))
+    }
+}
+
+// yeoJohnson applies the Yeo-Johnson power transform for a single value,
+// handling the x>=0 and x<0 branches and the lambda singularities.
+func yeoJohnson(x, lambda float64) float64 {
+    const eps = 1e-6
+
+    if x >= 0 {
+        if math.Abs(lambda) < eps {
+            return math.Log1p(x)
+        }
+        return (math.Pow(x+1, lambda) - 1) / lambda
+    }
+
+    if math.Abs(lambda-2) < eps {
+        return -math.Log1p(-x)
+    }
+    return -(math.Pow(-x+1, 2-lambda) - 1) / (2 - lambda)
+}
+
+// 分类特征编码（target/frequency 模式；onehot 模式在 expandOneHot 中处理）
+func (ft *FeatureTransforms) applyCategoricalEncoder(features []float64, transform TransformParams) {
+    if transform.Options["mode"] == "onehot" {
+        return
+    }
+
+    errors := []string{}
+    for i, featureIdx := range transform.FeatureIndices {
+        if featureIdx < 0 || featureIdx >= len(features) {
+            continue
+        }
+
+        stats := transform.Stats[i]
+        key := categoryKey(features[featureIdx])
+        if stat, ok := stats[key]; ok {
+            features[featureIdx] = stat
+        } else if fallback, ok := stats["default"]; ok {
+            features[featureIdx] = fallback
+        } else {
+            errors = append(errors, fmt.Sprintf("unseen category for feature %d with no fallback stat", featureIdx))
+        }
+    }
+
+    if len(errors) > 0 {
+        log.Errorln("[Smart] CategoricalEncoder errors: %s", strings.Join(errors, "; "))
+    }
+}
+
 func (ft *FeatureTransforms) ValidateTransforms(expectedFeatureCount int) error {
     if ft == nil {
         return fmt.Errorf("FeatureTransforms is nil")
@@ -481,7 +1214,7 @@ func (ft *FeatureTransforms) ValidateTransforms(expectedFeatureCount int) error
 
     for i, transform := range ft.Transforms {
         switch transform.Type {
-        case StandardScalerTransform, RobustScalerTransform:
+        case StandardScalerTransform, RobustScalerTransform, QuantileTransformerTransform, PowerTransformerTransform, CategoricalEncoderTransform:
         default:
             return fmt.Errorf("transform %d: unsupported transform type %s", i, transform.Type)
         }
@@ -536,6 +1269,59 @@ func (ft *FeatureTransforms) validateTransformParams(transform TransformParams)
                 return fmt.Errorf("RobustScaler scale[%d] is zero", i)
             }
         }
+
+    case QuantileTransformerTransform:
+        references := transform.Parameters["references"]
+        if len(references) == 0 {
+            return fmt.Errorf("QuantileTransformer missing references")
+        }
+        for i := range transform.FeatureIndices {
+            quantiles := transform.Parameters[fmt.Sprintf("quantiles_%d", i)]
+            if len(quantiles) != len(references) {
+                return fmt.Errorf("QuantileTransformer quantiles_%d length mismatch with references", i)
+            }
+        }
+        if output, exists := transform.Options["output"]; exists {
+            if output != "normal" && output != "uniform" {
+                return fmt.Errorf("QuantileTransformer unsupported output distribution %q", output)
+            }
+        }
+
+    case PowerTransformerTransform:
+        lambdas := transform.Parameters["lambdas"]
+        mean := transform.Parameters["mean"]
+        scale := transform.Parameters["scale"]
+        if len(lambdas) != len(transform.FeatureIndices) {
+            return fmt.Errorf("PowerTransformer lambdas parameter count mismatch")
+        }
+        if len(mean) != len(transform.FeatureIndices) {
+            return fmt.Errorf("PowerTransformer mean parameter count mismatch")
+        }
+        if len(scale) != len(transform.FeatureIndices) {
+            return fmt.Errorf("PowerTransformer scale parameter count mismatch")
+        }
+        for i, s := range scale {
+            if s == 0 {
+                return fmt.Errorf("PowerTransformer scale[%d] is zero", i)
+            }
+        }
+
+    case CategoricalEncoderTransform:
+        switch transform.Options["mode"] {
+        case "onehot", "target", "frequency", "":
+        default:
+            return fmt.Errorf("CategoricalEncoder unsupported mode %q", transform.Options["mode"])
+        }
+
+        for i := range transform.FeatureIndices {
+            if transform.Options["mode"] == "onehot" {
+                if len(transform.Vocab[i]) == 0 {
+                    return fmt.Errorf("CategoricalEncoder vocab_%d is empty", i)
+                }
+            } else if len(transform.Stats[i]) == 0 {
+                return fmt.Errorf("CategoricalEncoder stat_%d is empty", i)
+            }
+        }
     }
 
     return nil
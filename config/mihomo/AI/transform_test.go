@@ -0,0 +1,100 @@
+package lightgbm
+
+import (
+    "sync"
+    "testing"
+)
+
+func testTransforms() *FeatureTransforms {
+    return &FeatureTransforms{
+        TransformsEnabled: true,
+        FeatureOrder:      getDefaultFeatureOrder(),
+        Transforms: []TransformParams{
+            {
+                ID:             "std",
+                Type:           StandardScalerTransform,
+                FeatureIndices: []int{2, 3},
+                Parameters: map[string][]float64{
+                    "mean":  {1.0, 2.0},
+                    "scale": {2.0, 4.0},
+                },
+            },
+        },
+    }
+}
+
+// TestApplyTransformsConcurrent hammers ApplyTransforms from many goroutines
+// sharing a single FeatureTransforms to prove the pooled buffer fix in
+// ApplyTransforms/ApplyTransformsInto does not race or corrupt a caller's
+// output. Run with -race.
+func TestApplyTransformsConcurrent(t *testing.T) {
+    ft := testTransforms()
+
+    const goroutines = 64
+    const iterations = 200
+
+    var wg sync.WaitGroup
+    wg.Add(goroutines)
+    for g := 0; g < goroutines; g++ {
+        go func(g int) {
+            defer wg.Done()
+            in := make([]float64, len(ft.FeatureOrder))
+            for i := range in {
+                in[i] = float64(g)
+            }
+            want := (float64(g) - 1.0) / 2.0
+
+            for i := 0; i < iterations; i++ {
+                out := ft.ApplyTransforms(in)
+                if out[2] != want {
+                    t.Errorf("goroutine %d: out[2] = %v, want %v", g, out[2], want)
+                }
+                if in[2] != float64(g) {
+                    t.Errorf("goroutine %d: input features mutated to %v", g, in[2])
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+}
+
+// TestApplyTransformsIntoConcurrent is the same race check for the streaming
+// entry point, with each goroutine owning its own buffer as the API expects.
+func TestApplyTransformsIntoConcurrent(t *testing.T) {
+    ft := testTransforms()
+
+    const goroutines = 64
+    const iterations = 200
+
+    var wg sync.WaitGroup
+    wg.Add(goroutines)
+    for g := 0; g < goroutines; g++ {
+        go func(g int) {
+            defer wg.Done()
+            in := make([]float64, len(ft.FeatureOrder))
+            for i := range in {
+                in[i] = float64(g)
+            }
+            want := (float64(g) - 1.0) / 2.0
+
+            buf := ft.NewBuffer()
+            defer ft.ReleaseBuffer(buf)
+            needed := ft.OutputFeatureCount(len(in))
+            dst := buf[:needed]
+
+            for i := 0; i < iterations; i++ {
+                if err := ft.ApplyTransformsInto(dst, in); err != nil {
+                    // t.Fatalf must be called from the test's own
+                    // goroutine; here it would only exit this goroutine
+                    // rather than stop the test.
+                    t.Errorf("goroutine %d: ApplyTransformsInto: %v", g, err)
+                    return
+                }
+                if dst[2] != want {
+                    t.Errorf("goroutine %d: dst[2] = %v, want %v", g, dst[2], want)
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+}